@@ -20,15 +20,20 @@ limitations under the License.
 package controller
 
 import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/imdario/mergo"
+	"software.sslmate.com/src/go-pkcs12"
 
 	apiv1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
 
 	"github.com/stolostron/management-ingress/pkg/ingress"
 	"github.com/stolostron/management-ingress/pkg/ingress/annotations/class"
@@ -36,18 +41,54 @@ import (
 	"github.com/stolostron/management-ingress/pkg/net/ssl"
 )
 
+// secretParseFailedReason is the Event reason recorded on an Ingress when a
+// secret it references fails to parse into an SSLCert.
+const secretParseFailedReason = "SecretParseFailed"
+
+// keys under which a PKCS#12 (.pfx/.p12) keystore and its password may be
+// stored in a Secret, so operators can reuse Java/Windows-oriented keystores
+// as ingress TLS material instead of converting them to tls.crt/tls.key.
+var pkcs12KeystoreKeys = []string{"keystore.p12", "keystore.pfx", "tls.p12", "tls.pfx"}
+
+const pkcs12PasswordKey = "keystore-password"
+
+// getFakeSSLCert and addOrUpdateCertAndKey are indirected through package
+// variables, rather than called on ssl directly, so tests can substitute
+// fakes for syncDefaultSSLCertificate without writing real certificates to
+// disk.
+var (
+	getFakeSSLCert        = ssl.GetFakeSSLCert
+	addOrUpdateCertAndKey = ssl.AddOrUpdateCertAndKey
+)
+
 // syncSecret keeps in sync Secrets used by Ingress rules with the files on
 // disk to allow copy of the content of the secret to disk to be used
 // by external processes.
 func (ic *NGINXController) syncSecret(key string) {
-	glog.V(3).Infof("starting syncing of secret %v", key)
+	if !ic.secretIngressMap.Has(key) {
+		// no Ingress references this secret, so there is nothing to parse
+		// or reload NGINX for; this is the common case in clusters where
+		// cert-manager or similar churns secrets unrelated to any Ingress.
+		klog.V(3).InfoS("ignoring sync of secret: no Ingress references it", "secret", key)
+		return
+	}
 
+	klog.V(3).InfoS("starting syncing of secret", "secret", key)
+
+	start := time.Now()
 	cert, err := ic.getPemCertificate(key)
+	sslSecretSyncDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		glog.Warningf("error obtaining PEM from secret %v: %v", key, err)
+		sslSecretSyncTotal.WithLabelValues("failure").Inc()
+		klog.ErrorS(err, "error obtaining PEM from secret", "secret", key)
+		ic.recordSecretParseFailure(key, err)
 		return
 	}
 
+	sslSecretSyncTotal.WithLabelValues("success").Inc()
+	sslSecretLastSyncTimestamp.WithLabelValues(key).Set(float64(time.Now().Unix()))
+	sslCertExpiry.WithLabelValues(key).Set(float64(cert.ExpireTime.Unix()))
+
 	// create certificates and add or update the item in the store
 	cur, exists := ic.sslCertTracker.Get(key)
 	if exists {
@@ -56,21 +97,158 @@ func (ic *NGINXController) syncSecret(key string) {
 			// no need to update
 			return
 		}
-		glog.Infof("updating secret %v in the local store", key)
+		klog.InfoS("updating secret in the local store", "secret", key)
 		ic.sslCertTracker.Update(key, cert)
-		// this update must trigger an update
-		// (like an update event from a change in Ingress)
-		ic.syncQueue.Enqueue(&networking.Ingress{})
+		ic.handleSSLCertUpdate(key, cert)
 		return
 	}
 
-	glog.Infof("adding secret %v to the local store", key)
+	klog.InfoS("adding secret to the local store", "secret", key)
 	ic.sslCertTracker.Add(key, cert)
+	ic.handleSSLCertUpdate(key, cert)
+}
+
+// recordSecretParseFailure emits a Kubernetes Event on every Ingress that
+// references secretKey, so a failure to parse the secret shows up in
+// `kubectl describe ingress` instead of only in the controller logs.
+func (ic *NGINXController) recordSecretParseFailure(secretKey string, parseErr error) {
+	for _, ingressKey := range ic.secretIngressMap.Ingresses(secretKey) {
+		ing := ic.getIngress(ingressKey)
+		if ing == nil {
+			continue
+		}
+
+		ic.recorder.Eventf(ing, apiv1.EventTypeWarning, secretParseFailedReason,
+			"error parsing referenced secret %v: %v", secretKey, parseErr)
+	}
+}
+
+// getIngress returns the Ingress tracked under key ("namespace/name"), or
+// nil if it is no longer present.
+func (ic *NGINXController) getIngress(key string) *networking.Ingress {
+	for _, obj := range ic.listers.Ingress.List() {
+		ing := obj.(*networking.Ingress)
+		if fmt.Sprintf("%v/%v", ing.Namespace, ing.Name) == key {
+			return ing
+		}
+	}
+
+	return nil
+}
+
+// handleSSLCertUpdate notifies the rest of the controller that the tracked
+// SSLCert for key was added or changed. When dynamic certificates are
+// enabled the cert/key PEM is pushed straight into the running NGINX
+// through certManager, once per server name the secret serves (see
+// serverNames), so the rotation takes effect immediately with no NGINX
+// config reload. Otherwise this falls back to queueing a regular Ingress
+// resync, which is what triggers the reload.
+func (ic *NGINXController) handleSSLCertUpdate(key string, cert *ingress.SSLCert) {
+	if ic.cfg.EnableDynamicCertificates {
+		payload, err := json.Marshal(cert)
+		if err != nil {
+			klog.ErrorS(err, "error marshalling SSL certificate for dynamic update", "secret", key)
+			return
+		}
+
+		for _, serverName := range ic.serverNames(key, cert) {
+			if err := ic.certManager.Push(serverName, payload); err != nil {
+				klog.ErrorS(err, "error pushing SSL certificate to NGINX, falling back to a reload", "secret", key, "server", serverName)
+				ic.syncQueue.Enqueue(&networking.Ingress{})
+				return
+			}
+		}
+
+		klog.V(3).InfoS("pushed SSL certificate to NGINX without a reload", "secret", key)
+		return
+	}
+
 	// this update must trigger an update
 	// (like an update event from a change in Ingress)
 	ic.syncQueue.Enqueue(&networking.Ingress{})
 }
 
+// serverNames returns the NGINX server names the secret identified by key
+// serves TLS for, collected from spec.tls[].hosts of every Ingress that
+// references it through that secret. A secret is commonly shared by
+// Ingresses covering several hostnames, or backs a single SAN/wildcard
+// certificate serving many of them, so pushing a dynamic update under only
+// the certificate's own CN would leave every other hostname it serves on
+// stale material until the next full reload. Falls back to the
+// certificate's CN when the secret isn't referenced through spec.tls at all
+// (for example, a secret only used via the auth-tls-secret annotation).
+func (ic *NGINXController) serverNames(key string, cert *ingress.SSLCert) []string {
+	var names []string
+
+	for _, ingressKey := range ic.secretIngressMap.Ingresses(key) {
+		ing := ic.getIngress(ingressKey)
+		if ing == nil {
+			continue
+		}
+
+		for _, tls := range ing.Spec.TLS {
+			if tls.SecretName == "" {
+				continue
+			}
+			if fmt.Sprintf("%v/%v", ing.Namespace, tls.SecretName) != key {
+				continue
+			}
+			names = append(names, tls.Hosts...)
+		}
+	}
+
+	if len(names) == 0 {
+		return []string{cert.CN}
+	}
+
+	return names
+}
+
+// defServerName is the server name NGINX's default server block answers
+// TLS handshakes on behalf of, for requests that match no Ingress host.
+const defServerName = "_"
+
+// defaultSSLCertificateKey is the sslCertTracker key the default/fallback
+// certificate is stored under.
+const defaultSSLCertificateKey = "default/" + defServerName
+
+// syncDefaultSSLCertificate makes sure sslCertTracker always has a usable
+// default certificate to answer TLS handshakes that match no Ingress TLS
+// secret. When ic.cfg.DefaultSSLCertificate is configured it is resolved
+// once here, through the regular getPemCertificate path, which always
+// writes the PEM to disk even when dynamic certificates are enabled: the
+// default server block reads its certificate from disk, not from NGINX's
+// Lua dynamic-certificate endpoint. Otherwise a self-signed "snake-oil"
+// certificate is generated so connections still get a valid handshake
+// instead of a plaintext error.
+func (ic *NGINXController) syncDefaultSSLCertificate() {
+	if ic.cfg.DefaultSSLCertificate != "" {
+		cert, err := ic.getPemCertificate(ic.cfg.DefaultSSLCertificate)
+		if err != nil {
+			klog.ErrorS(err, "error obtaining default SSL certificate", "secret", ic.cfg.DefaultSSLCertificate)
+			return
+		}
+
+		ic.sslCertTracker.Add(defaultSSLCertificateKey, cert)
+		return
+	}
+
+	pemCert, pemKey := getFakeSSLCert()
+	if pemCert == nil || pemKey == nil {
+		klog.ErrorS(nil, "error generating fake SSL certificate")
+		return
+	}
+
+	cert, err := addOrUpdateCertAndKey(defServerName, pemCert, pemKey, nil)
+	if err != nil {
+		klog.ErrorS(err, "error generating fake SSL certificate")
+		return
+	}
+
+	klog.InfoS("no default SSL certificate configured, using a generated fake certificate", "cn", cert.CN)
+	ic.sslCertTracker.Add(defaultSSLCertificateKey, cert)
+}
+
 // getPemCertificate receives a secret, and creates a ingress.SSLCert as return.
 // It parses the secret and verifies if it's a keypair, or a 'ca.crt' secret only.
 func (ic *NGINXController) getPemCertificate(secretName string) (*ingress.SSLCert, error) {
@@ -83,6 +261,19 @@ func (ic *NGINXController) getPemCertificate(secretName string) (*ingress.SSLCer
 	key, okkey := secret.Data[apiv1.TLSPrivateKeyKey]
 	ca := secret.Data["ca.crt"]
 
+	if !okcert && !okkey && ca == nil {
+		if keystore, found := getPKCS12Keystore(secret.Data); found {
+			p12Cert, p12Key, p12CA, err := decodePKCS12Keystore(keystore, secret.Data[pkcs12PasswordKey])
+			if err != nil {
+				return nil, fmt.Errorf("error decoding PKCS#12 keystore in secret %v: %v", secretName, err)
+			}
+
+			cert, okcert = p12Cert, p12Cert != nil
+			key, okkey = p12Key, p12Key != nil
+			ca = p12CA
+		}
+	}
+
 	// namespace/secretName -> namespace-secretName
 	nsSecName := strings.Replace(secretName, "/", "-", -1)
 
@@ -97,14 +288,14 @@ func (ic *NGINXController) getPemCertificate(secretName string) (*ingress.SSLCer
 
 		// If 'ca.crt' is also present, it will allow this secret to be used in the
 		// 'nginx.ingress.kubernetes.io/auth-tls-secret' annotation
-		s, err = ssl.AddOrUpdateCertAndKey(nsSecName, cert, key, ca)
+		s, err = addOrUpdateCertAndKey(nsSecName, cert, key, ca)
 		if err != nil {
 			return nil, fmt.Errorf("unexpected error creating pem file: %v", err)
 		}
 
-		glog.V(3).Infof("found 'tls.crt' and 'tls.key', configuring %v as a TLS Secret (CN: %v)", secretName, s.CN)
+		klog.V(3).InfoS("found 'tls.crt' and 'tls.key', configuring secret as a TLS Secret", "secret", secretName, "cn", s.CN)
 		if ca != nil {
-			glog.V(3).Infof("found 'ca.crt', secret %v can also be used for Certificate Authentication", secretName)
+			klog.V(3).InfoS("found 'ca.crt', secret can also be used for Certificate Authentication", "secret", secretName)
 		}
 
 	} else if ca != nil {
@@ -116,7 +307,7 @@ func (ic *NGINXController) getPemCertificate(secretName string) (*ingress.SSLCer
 
 		// makes this secret in 'syncSecret' to be used for Certificate Authentication
 		// this does not enable Certificate Authentication
-		glog.V(3).Infof("found only 'ca.crt', configuring %v as an Certificate Authentication Secret", secretName)
+		klog.V(3).InfoS("found only 'ca.crt', configuring secret as a Certificate Authentication Secret", "secret", secretName)
 
 	} else {
 		return nil, fmt.Errorf("no keypair or CA cert could be found in %v", secretName)
@@ -139,14 +330,16 @@ func (ic *NGINXController) checkSSLChainIssues() {
 
 		data, err := ssl.FullChainCert(secret.PemFileName)
 		if err != nil {
-			glog.Errorf("unexpected error generating SSL certificate with full intermediate chain CA certs: %v", err)
+			sslChainCompletionTotal.WithLabelValues("failure").Inc()
+			klog.ErrorS(err, "unexpected error generating SSL certificate with full intermediate chain CA certs", "secret", secretName)
 			continue
 		}
 
 		fullChainPemFileName := fmt.Sprintf("%v/%v-%v-full-chain.pem", ingress.DefaultSSLDirectory, secret.Namespace, secret.Name)
 		err = ioutil.WriteFile(fullChainPemFileName, data, 0600)
 		if err != nil {
-			glog.Errorf("unexpected error creating SSL certificate: %v", err)
+			sslChainCompletionTotal.WithLabelValues("failure").Inc()
+			klog.ErrorS(err, "unexpected error creating SSL certificate", "secret", secretName)
 			continue
 		}
 
@@ -154,13 +347,15 @@ func (ic *NGINXController) checkSSLChainIssues() {
 
 		err = mergo.MergeWithOverwrite(dst, secret)
 		if err != nil {
-			glog.Errorf("unexpected error creating SSL certificate: %v", err)
+			sslChainCompletionTotal.WithLabelValues("failure").Inc()
+			klog.ErrorS(err, "unexpected error creating SSL certificate", "secret", secretName)
 			continue
 		}
 
 		dst.FullChainPemFileName = fullChainPemFileName
 
-		glog.Infof("updating local copy of ssl certificate %v with missing intermediate CA certs", secretName)
+		sslChainCompletionTotal.WithLabelValues("success").Inc()
+		klog.InfoS("updating local copy of ssl certificate with missing intermediate CA certs", "secret", secretName)
 		ic.sslCertTracker.Update(secretName, dst)
 		// this update must trigger an update
 		// (like an update event from a change in Ingress)
@@ -170,8 +365,15 @@ func (ic *NGINXController) checkSSLChainIssues() {
 
 // checkMissingSecrets verify if one or more ingress rules contains a reference
 // to a secret that is not present in the local secret store.
-// In this case we call syncSecret.
+// In this case we call syncSecret. It also rebuilds ic.secretIngressMap, the
+// secretKey -> ingressKeys index syncSecret consults to ignore events for
+// secrets that no Ingress references, and drops the per-secret Prometheus
+// series for any secret that falls out of that index so a churny cluster
+// doesn't leak label series for secrets nobody references any more.
 func (ic *NGINXController) checkMissingSecrets() {
+	previouslyTracked := ic.secretIngressMap.Keys()
+	ic.secretIngressMap.Clear()
+
 	for _, obj := range ic.listers.Ingress.List() {
 		ing := obj.(*networking.Ingress)
 
@@ -179,12 +381,15 @@ func (ic *NGINXController) checkMissingSecrets() {
 			continue
 		}
 
+		ingressKey := fmt.Sprintf("%v/%v", ing.Namespace, ing.Name)
+
 		for _, tls := range ing.Spec.TLS {
 			if tls.SecretName == "" {
 				continue
 			}
 
 			key := fmt.Sprintf("%v/%v", ing.Namespace, tls.SecretName)
+			ic.secretIngressMap.Add(key, ingressKey)
 			if _, ok := ic.sslCertTracker.Get(key); !ok {
 				ic.syncSecret(key)
 			}
@@ -195,8 +400,89 @@ func (ic *NGINXController) checkMissingSecrets() {
 			continue
 		}
 
+		ic.secretIngressMap.Add(key, ingressKey)
 		if _, ok := ic.sslCertTracker.Get(key); !ok {
 			ic.syncSecret(key)
 		}
 	}
+
+	for _, key := range previouslyTracked {
+		if ic.secretIngressMap.Has(key) {
+			continue
+		}
+
+		klog.V(3).InfoS("secret no longer referenced by any Ingress, dropping its metrics", "secret", key)
+		sslSecretLastSyncTimestamp.DeleteLabelValues(key)
+		sslCertExpiry.DeleteLabelValues(key)
+	}
+}
+
+// getPKCS12Keystore looks up a PKCS#12 keystore blob under any of the
+// conventional keys a Secret might store it at.
+func getPKCS12Keystore(data map[string][]byte) ([]byte, bool) {
+	for _, key := range pkcs12KeystoreKeys {
+		if keystore, ok := data[key]; ok && len(keystore) > 0 {
+			return keystore, true
+		}
+	}
+
+	return nil, false
+}
+
+// decodePKCS12Keystore converts a PKCS#12 keystore into PEM-encoded
+// certificate, private key and CA chain material so it can be handed to
+// ssl.AddOrUpdateCertAndKey/ssl.AddCertAuth the same way tls.crt/tls.key is.
+// A keystore with no private key (only trusted certificates) is treated as a
+// CA-only store.
+func decodePKCS12Keystore(keystore, password []byte) (certPEM, keyPEM, caPEM []byte, err error) {
+	pw := string(password)
+
+	// DecodeChain matches the leaf certificate to the private key itself,
+	// instead of assuming bag order, since PKCS#12 keystores are not
+	// guaranteed to list the leaf certificate before its CA chain.
+	priv, leaf, caCerts, err := pkcs12.DecodeChain(keystore, pw)
+	if err == nil {
+		keyPEM, err = encodePrivateKeyPEM(priv)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error encoding private key from keystore: %v", err)
+		}
+
+		certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+		for _, c := range caCerts {
+			caPEM = append(caPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+
+		return certPEM, keyPEM, caPEM, nil
+	}
+
+	// DecodeChain fails for a keystore holding only trusted CA certificates
+	// and no private key; fall back to treating every certificate in the
+	// bag as a CA cert.
+	blocks, blocksErr := pkcs12.ToPEM(keystore, pw)
+	if blocksErr != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding keystore (check '%v'): %v", pkcs12PasswordKey, err)
+	}
+
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			caPEM = append(caPEM, pem.EncodeToMemory(block)...)
+		}
+	}
+
+	if caPEM == nil {
+		return nil, nil, nil, fmt.Errorf("no certificates found in keystore")
+	}
+
+	return nil, nil, caPEM, nil
+}
+
+// encodePrivateKeyPEM PEM-encodes a private key decoded from a PKCS#12
+// keystore, which may be an RSA or ECDSA key, as PKCS#8.
+func encodePrivateKeyPEM(key interface{}) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
 }
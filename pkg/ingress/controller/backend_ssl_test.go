@@ -0,0 +1,358 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/stolostron/management-ingress/pkg/ingress"
+)
+
+func newTestCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	signer := template
+	signerKey := key
+	if parent != nil {
+		signer = parent
+		signerKey = parentKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+
+	return cert, key
+}
+
+func TestDecodePKCS12KeystoreMultiCertBag(t *testing.T) {
+	ca, caKey := newTestCert(t, "test-ca", true, nil, nil)
+	leaf, leafKey := newTestCert(t, "test-leaf", false, ca, caKey)
+
+	keystore, err := pkcs12.Encode(rand.Reader, leafKey, leaf, []*x509.Certificate{ca}, "s3cr3t")
+	if err != nil {
+		t.Fatalf("error encoding PKCS#12 keystore: %v", err)
+	}
+
+	certPEM, keyPEM, caPEM, err := decodePKCS12Keystore(keystore, []byte("s3cr3t"))
+	if err != nil {
+		t.Fatalf("decodePKCS12Keystore returned error: %v", err)
+	}
+
+	if len(certPEM) == 0 || len(keyPEM) == 0 || len(caPEM) == 0 {
+		t.Fatalf("expected cert, key and CA PEM to all be populated, got cert=%d key=%d ca=%d bytes",
+			len(certPEM), len(keyPEM), len(caPEM))
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("expected certPEM to hold a PEM-encoded certificate")
+	}
+	parsedCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("error parsing leaf certificate: %v", err)
+	}
+	if parsedCert.Subject.CommonName != "test-leaf" {
+		t.Fatalf("expected leaf certificate, got CN %v", parsedCert.Subject.CommonName)
+	}
+}
+
+func TestDecodePKCS12KeystoreWrongPassword(t *testing.T) {
+	leaf, leafKey := newTestCert(t, "test-leaf", false, nil, nil)
+
+	keystore, err := pkcs12.Encode(rand.Reader, leafKey, leaf, nil, "s3cr3t")
+	if err != nil {
+		t.Fatalf("error encoding PKCS#12 keystore: %v", err)
+	}
+
+	if _, _, _, err := decodePKCS12Keystore(keystore, []byte("wrong-password")); err == nil {
+		t.Fatal("expected an error decoding with the wrong password, got nil")
+	}
+}
+
+func TestDecodePKCS12KeystoreCAOnly(t *testing.T) {
+	ca, _ := newTestCert(t, "test-ca", true, nil, nil)
+
+	keystore, err := pkcs12.EncodeTrustStore(rand.Reader, []*x509.Certificate{ca}, "s3cr3t")
+	if err != nil {
+		t.Fatalf("error encoding PKCS#12 trust store: %v", err)
+	}
+
+	certPEM, keyPEM, caPEM, err := decodePKCS12Keystore(keystore, []byte("s3cr3t"))
+	if err != nil {
+		t.Fatalf("decodePKCS12Keystore returned error: %v", err)
+	}
+
+	if certPEM != nil || keyPEM != nil {
+		t.Fatalf("expected no leaf certificate or key for a CA-only store, got cert=%d key=%d bytes", len(certPEM), len(keyPEM))
+	}
+	if len(caPEM) == 0 {
+		t.Fatal("expected the CA certificate to be returned")
+	}
+}
+
+type fakeSecretLister struct {
+	secrets map[string]*apiv1.Secret
+}
+
+func (f *fakeSecretLister) GetByName(name string) (*apiv1.Secret, error) {
+	secret, ok := f.secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %v not found", name)
+	}
+	return secret, nil
+}
+
+type fakeSSLCertTracker struct {
+	certs map[string]*ingress.SSLCert
+}
+
+func newFakeSSLCertTracker() *fakeSSLCertTracker {
+	return &fakeSSLCertTracker{certs: map[string]*ingress.SSLCert{}}
+}
+
+func (f *fakeSSLCertTracker) Get(key string) (interface{}, bool) {
+	cert, ok := f.certs[key]
+	return cert, ok
+}
+
+func (f *fakeSSLCertTracker) Add(key string, cert *ingress.SSLCert) {
+	f.certs[key] = cert
+}
+
+func (f *fakeSSLCertTracker) Update(key string, cert *ingress.SSLCert) {
+	f.certs[key] = cert
+}
+
+func (f *fakeSSLCertTracker) ListKeys() []string {
+	keys := make([]string, 0, len(f.certs))
+	for key := range f.certs {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// withFakeSSLFuncs substitutes getFakeSSLCert and addOrUpdateCertAndKey for
+// the duration of a test, restoring the originals on cleanup, so tests never
+// depend on the real ssl package writing certificates to disk.
+func withFakeSSLFuncs(t *testing.T, fakeCert func() ([]byte, []byte), addOrUpdate func(name string, cert, key, ca []byte) (*ingress.SSLCert, error)) {
+	t.Helper()
+
+	origFakeCert, origAddOrUpdate := getFakeSSLCert, addOrUpdateCertAndKey
+	t.Cleanup(func() {
+		getFakeSSLCert, addOrUpdateCertAndKey = origFakeCert, origAddOrUpdate
+	})
+
+	if fakeCert != nil {
+		getFakeSSLCert = fakeCert
+	}
+	if addOrUpdate != nil {
+		addOrUpdateCertAndKey = addOrUpdate
+	}
+}
+
+func TestSyncDefaultSSLCertificateGeneratesFakeCert(t *testing.T) {
+	withFakeSSLFuncs(t,
+		func() ([]byte, []byte) { return []byte("fake-cert"), []byte("fake-key") },
+		func(name string, cert, key, ca []byte) (*ingress.SSLCert, error) {
+			if name != defServerName {
+				t.Fatalf("expected server name %q, got %q", defServerName, name)
+			}
+			if string(cert) != "fake-cert" || string(key) != "fake-key" {
+				t.Fatalf("expected the generated fake certificate and key to be passed through")
+			}
+			return &ingress.SSLCert{CN: "Kubernetes Ingress Controller Fake Certificate"}, nil
+		},
+	)
+
+	tracker := newFakeSSLCertTracker()
+	ic := &NGINXController{
+		cfg:            &Configuration{},
+		sslCertTracker: tracker,
+	}
+
+	ic.syncDefaultSSLCertificate()
+
+	cert, ok := tracker.Get(defaultSSLCertificateKey)
+	if !ok {
+		t.Fatal("expected a default SSL certificate to be tracked")
+	}
+	if cn := cert.(*ingress.SSLCert).CN; cn != "Kubernetes Ingress Controller Fake Certificate" {
+		t.Fatalf("expected the generated fake certificate to be tracked, got CN %v", cn)
+	}
+}
+
+func TestSyncDefaultSSLCertificateUsesConfigured(t *testing.T) {
+	secretKey := "kube-system/custom-cert"
+	secret := &apiv1.Secret{
+		Data: map[string][]byte{
+			apiv1.TLSCertKey:       []byte("configured-cert"),
+			apiv1.TLSPrivateKeyKey: []byte("configured-key"),
+		},
+	}
+	secret.Name = "custom-cert"
+	secret.Namespace = "kube-system"
+
+	withFakeSSLFuncs(t, nil,
+		func(name string, cert, key, ca []byte) (*ingress.SSLCert, error) {
+			if string(cert) != "configured-cert" || string(key) != "configured-key" {
+				t.Fatalf("expected the configured secret's cert/key to be passed through")
+			}
+			return &ingress.SSLCert{CN: "configured-cert"}, nil
+		},
+	)
+
+	tracker := newFakeSSLCertTracker()
+	ic := &NGINXController{
+		cfg: &Configuration{DefaultSSLCertificate: secretKey},
+		listers: &storeLister{
+			Secret: &fakeSecretLister{secrets: map[string]*apiv1.Secret{secretKey: secret}},
+		},
+		sslCertTracker: tracker,
+	}
+
+	ic.syncDefaultSSLCertificate()
+
+	cert, ok := tracker.Get(defaultSSLCertificateKey)
+	if !ok {
+		t.Fatal("expected the configured default SSL certificate to be tracked")
+	}
+	if cn := cert.(*ingress.SSLCert).CN; cn != "configured-cert" {
+		t.Fatalf("expected the configured certificate to be tracked, got CN %v", cn)
+	}
+}
+
+func TestGetPKCS12Keystore(t *testing.T) {
+	data := map[string][]byte{
+		"keystore.p12":   []byte("blob"),
+		pkcs12PasswordKey: []byte("s3cr3t"),
+	}
+
+	keystore, found := getPKCS12Keystore(data)
+	if !found {
+		t.Fatal("expected to find a keystore under 'keystore.p12'")
+	}
+	if string(keystore) != "blob" {
+		t.Fatalf("expected keystore bytes %q, got %q", "blob", keystore)
+	}
+
+	if _, found := getPKCS12Keystore(map[string][]byte{"tls.crt": []byte("x")}); found {
+		t.Fatal("expected no keystore to be found in a secret with no PKCS#12 data")
+	}
+}
+
+type fakeIngressLister struct {
+	ingresses []interface{}
+}
+
+func (f *fakeIngressLister) List() []interface{} {
+	return f.ingresses
+}
+
+func TestServerNamesCollectsHostsFromReferencingIngresses(t *testing.T) {
+	secretKey := "default/example-tls"
+
+	ing := &networking.Ingress{
+		Spec: networking.IngressSpec{
+			TLS: []networking.IngressTLS{
+				{SecretName: "example-tls", Hosts: []string{"a.example.com", "b.example.com"}},
+			},
+		},
+	}
+	ing.Namespace = "default"
+	ing.Name = "example"
+
+	secretIngressMap := newSecretIngressMap()
+	secretIngressMap.Add(secretKey, "default/example")
+
+	ic := &NGINXController{
+		listers: &storeLister{
+			Ingress: &fakeIngressLister{ingresses: []interface{}{ing}},
+		},
+		secretIngressMap: secretIngressMap,
+	}
+
+	names := ic.serverNames(secretKey, &ingress.SSLCert{CN: "example.com"})
+
+	want := []string{"a.example.com", "b.example.com"}
+	if len(names) != len(want) {
+		t.Fatalf("expected server names %v, got %v", want, names)
+	}
+	for i, name := range want {
+		if names[i] != name {
+			t.Fatalf("expected server names %v, got %v", want, names)
+		}
+	}
+}
+
+func TestServerNamesFallsBackToCertCN(t *testing.T) {
+	secretKey := "default/auth-ca"
+
+	secretIngressMap := newSecretIngressMap()
+	secretIngressMap.Add(secretKey, "default/example")
+
+	ic := &NGINXController{
+		listers: &storeLister{
+			Ingress: &fakeIngressLister{},
+		},
+		secretIngressMap: secretIngressMap,
+	}
+
+	names := ic.serverNames(secretKey, &ingress.SSLCert{CN: "example.com"})
+
+	if len(names) != 1 || names[0] != "example.com" {
+		t.Fatalf("expected fallback to the certificate CN, got %v", names)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package certmanager pushes TLS certificate/key material straight into the
+// running NGINX worker process, keyed by server name, over a local Unix
+// socket served by a Lua handler inside NGINX. This lets cert rotations take
+// effect immediately without going through an Ingress resync and the
+// resulting NGINX configuration rewrite and reload.
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultSocket is the Unix socket the in-NGINX Lua certificate handler
+// listens on for dynamic certificate updates.
+const DefaultSocket = "/tmp/nginx-cert-manager.sock"
+
+// configureEndpoint is the path prefix the Lua handler exposes to accept a
+// new certificate for a server name, given as a trailing path segment
+// (e.g. "/configure/www.example.com"), so the Lua handler can route on it
+// directly instead of having to infer it from the request body.
+const configureEndpoint = "http://unix/configure"
+
+// Manager pushes certificate updates to the Lua dynamic-certificate endpoint
+// exposed by NGINX over a local Unix socket, instead of relying on an NGINX
+// config reload to pick up changed TLS material.
+type Manager struct {
+	socket string
+	client *http.Client
+}
+
+// NewManager returns a Manager that talks to the Lua handler listening on
+// socket. An empty socket defaults to DefaultSocket.
+func NewManager(socket string) *Manager {
+	if socket == "" {
+		socket = DefaultSocket
+	}
+
+	return &Manager{
+		socket: socket,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return net.DialTimeout("unix", socket, 5*time.Second)
+				},
+			},
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// Push sends the JSON-encoded certificate payload for serverName to the Lua
+// handler so NGINX starts serving it immediately, with no reload required.
+// serverName is carried explicitly as a path segment so the Lua handler
+// doesn't have to infer routing from whatever the marshaled JSON happens to
+// contain.
+func (m *Manager) Push(serverName string, certJSON []byte) error {
+	endpoint := fmt.Sprintf("%s/%s", configureEndpoint, url.PathEscape(serverName))
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(certJSON))
+	if err != nil {
+		return fmt.Errorf("error building dynamic certificate request for %v: %v", serverName, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing certificate for %v to %v: %v", serverName, m.socket, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v pushing certificate for %v to %v", resp.Status, serverName, m.socket)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package controller
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/stolostron/management-ingress/pkg/ingress"
+	"github.com/stolostron/management-ingress/pkg/ingress/controller/certmanager"
+)
+
+// Configuration holds the settings NGINXController needs to manage SSL
+// certificates.
+type Configuration struct {
+	// DefaultSSLCertificate is the "namespace/name" of the Secret to use as
+	// the default server's certificate. When empty, a generated self-signed
+	// certificate is used instead.
+	DefaultSSLCertificate string
+
+	// EnableDynamicCertificates pushes certificate updates into the running
+	// NGINX over the certmanager Unix socket instead of reloading NGINX.
+	EnableDynamicCertificates bool
+
+	// DynamicCertificatesSocket is the Unix socket certManager pushes
+	// dynamic certificate updates to. Defaults to certmanager.DefaultSocket.
+	DynamicCertificatesSocket string
+}
+
+// secretLister resolves a Secret given its "namespace/name" key.
+type secretLister interface {
+	GetByName(name string) (*apiv1.Secret, error)
+}
+
+// ingressLister lists the Ingress resources currently known to the store.
+type ingressLister interface {
+	List() []interface{}
+}
+
+// storeLister groups the listers NGINXController reads Kubernetes objects
+// from.
+type storeLister struct {
+	Secret  secretLister
+	Ingress ingressLister
+}
+
+// sslCertificateTracker is the local store of tracked ingress.SSLCert
+// objects, keyed by "namespace/secretName".
+type sslCertificateTracker interface {
+	Get(key string) (interface{}, bool)
+	Add(key string, cert *ingress.SSLCert)
+	Update(key string, cert *ingress.SSLCert)
+	ListKeys() []string
+}
+
+// workQueue enqueues an object for the next NGINX config sync.
+type workQueue interface {
+	Enqueue(obj interface{})
+}
+
+// NGINXController manages the lifecycle of an NGINX process that serves
+// Kubernetes Ingress resources, including keeping the SSL material it reads
+// from disk (or, with EnableDynamicCertificates, over the certmanager Unix
+// socket) in sync with the cluster's Secrets.
+type NGINXController struct {
+	cfg *Configuration
+
+	listers        *storeLister
+	sslCertTracker sslCertificateTracker
+	syncQueue      workQueue
+	recorder       record.EventRecorder
+
+	// secretIngressMap indexes which Ingress resources reference a given
+	// Secret, so syncSecret can ignore events for secrets nothing
+	// references.
+	secretIngressMap *secretIngressMap
+
+	// certManager pushes certificate updates to NGINX over a local Unix
+	// socket when cfg.EnableDynamicCertificates is set.
+	certManager *certmanager.Manager
+}
+
+// NewNGINXController returns an NGINXController wired to read Ingress and
+// Secret state from listers, track parsed certificates in tracker, enqueue
+// NGINX resyncs on queue, and record events through recorder. A nil cfg
+// falls back to the values bound to the flags registered in flags.go.
+func NewNGINXController(cfg *Configuration, listers *storeLister, tracker sslCertificateTracker, queue workQueue, recorder record.EventRecorder) *NGINXController {
+	if cfg == nil {
+		cfg = configurationFromFlags()
+	}
+
+	ic := &NGINXController{
+		cfg:              cfg,
+		listers:          listers,
+		sslCertTracker:   tracker,
+		syncQueue:        queue,
+		recorder:         recorder,
+		secretIngressMap: newSecretIngressMap(),
+	}
+
+	if cfg.EnableDynamicCertificates {
+		ic.certManager = certmanager.NewManager(cfg.DynamicCertificatesSocket)
+	}
+
+	ic.syncDefaultSSLCertificate()
+
+	return ic
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package controller
+
+import (
+	"flag"
+
+	"github.com/stolostron/management-ingress/pkg/ingress/controller/certmanager"
+)
+
+var (
+	defaultSSLCertificate = flag.String("default-ssl-certificate", "",
+		`Secret, in the form namespace/name, containing the default SSL certificate to
+be used for requests that don't match any of the configured server names. If not
+specified, a generated self-signed certificate is used.`)
+
+	enableDynamicCertificates = flag.Bool("enable-dynamic-certificates", false,
+		`Enable reload-free TLS certificate rotation: cert/key updates are pushed into
+the running NGINX over a local Unix socket instead of triggering an NGINX config reload.`)
+
+	dynamicCertificatesSocket = flag.String("dynamic-certificates-socket", certmanager.DefaultSocket,
+		`Path of the Unix socket the NGINX Lua dynamic-certificate handler listens on.`)
+)
+
+// configurationFromFlags builds a Configuration from the flags registered
+// in this file.
+func configurationFromFlags() *Configuration {
+	return &Configuration{
+		DefaultSSLCertificate:     *defaultSSLCertificate,
+		EnableDynamicCertificates: *enableDynamicCertificates,
+		DynamicCertificatesSocket: *dynamicCertificatesSocket,
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package controller
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Prometheus metrics covering SSL secret syncing, so cert rotation can be
+// observed without shelling into the controller pod.
+var (
+	sslSecretSyncTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "management_ingress",
+			Subsystem: "ssl",
+			Name:      "secret_sync_total",
+			Help:      "Number of SSL secret syncs, partitioned by result (success/failure).",
+		},
+		[]string{"result"},
+	)
+
+	sslChainCompletionTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "management_ingress",
+			Subsystem: "ssl",
+			Name:      "chain_completion_total",
+			Help:      "Number of attempts to complete a certificate's intermediate CA chain, partitioned by result (success/failure).",
+		},
+		[]string{"result"},
+	)
+
+	sslSecretSyncDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "management_ingress",
+			Subsystem: "ssl",
+			Name:      "secret_sync_duration_seconds",
+			Help:      "Time taken to parse an SSL secret into a certificate, regardless of outcome.",
+		},
+	)
+
+	sslSecretLastSyncTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "management_ingress",
+			Subsystem: "ssl",
+			Name:      "secret_last_sync_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful sync of a tracked SSL secret.",
+		},
+		[]string{"secret"},
+	)
+
+	sslCertExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "management_ingress",
+			Subsystem: "ssl",
+			Name:      "cert_expiry_timestamp_seconds",
+			Help:      "Unix timestamp when a tracked SSL certificate's leaf expires.",
+		},
+		[]string{"secret"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		sslSecretSyncTotal,
+		sslChainCompletionTotal,
+		sslSecretSyncDuration,
+		sslSecretLastSyncTimestamp,
+		sslCertExpiry,
+	)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package controller
+
+import "sync"
+
+// secretIngressMap indexes which Ingress resources reference a given
+// Secret, keyed by "namespace/secretName". checkMissingSecrets rebuilds it
+// on every Ingress resync, and syncSecret consults it to ignore events for
+// secrets that no Ingress currently references, which is the common case
+// in clusters where cert-manager or similar churns unrelated secrets.
+type secretIngressMap struct {
+	mu   sync.RWMutex
+	data map[string]map[string]bool
+}
+
+func newSecretIngressMap() *secretIngressMap {
+	return &secretIngressMap{data: make(map[string]map[string]bool)}
+}
+
+// Clear drops every tracked reference, ahead of a full rebuild.
+func (m *secretIngressMap) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data = make(map[string]map[string]bool)
+}
+
+// Add records that the Ingress identified by ingressKey references secretKey.
+func (m *secretIngressMap) Add(secretKey, ingressKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ingresses, ok := m.data[secretKey]
+	if !ok {
+		ingresses = make(map[string]bool)
+		m.data[secretKey] = ingresses
+	}
+	ingresses[ingressKey] = true
+}
+
+// Has reports whether any Ingress currently references secretKey.
+func (m *secretIngressMap) Has(secretKey string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.data[secretKey]) > 0
+}
+
+// Keys returns every secretKey currently tracked, i.e. referenced by at
+// least one Ingress.
+func (m *secretIngressMap) Keys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.data))
+	for secretKey := range m.data {
+		keys = append(keys, secretKey)
+	}
+
+	return keys
+}
+
+// Ingresses returns the keys of every Ingress that currently references
+// secretKey.
+func (m *secretIngressMap) Ingresses(secretKey string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ingresses := make([]string, 0, len(m.data[secretKey]))
+	for ingressKey := range m.data[secretKey] {
+		ingresses = append(ingresses, ingressKey)
+	}
+
+	return ingresses
+}
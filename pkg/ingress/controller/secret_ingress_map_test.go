@@ -0,0 +1,55 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package controller
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSecretIngressMapKeys(t *testing.T) {
+	m := newSecretIngressMap()
+	m.Add("default/a", "default/ing-a")
+	m.Add("default/b", "default/ing-b")
+
+	keys := m.Keys()
+	sort.Strings(keys)
+
+	if want := []string{"default/a", "default/b"}; !equalStrings(keys, want) {
+		t.Fatalf("expected keys %v, got %v", want, keys)
+	}
+
+	m.Clear()
+	if keys := m.Keys(); len(keys) != 0 {
+		t.Fatalf("expected no keys after Clear, got %v", keys)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}